@@ -0,0 +1,271 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// A codewalk is an XML document describing a guided tour through a set
+// of source files, alongside the .slide and .article content minidoc
+// already serves. The handler below is modeled after the codewalk
+// feature of the old godoc tool.
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io/fs"
+	log "minilog"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	http.HandleFunc("/codewalk/", func(w http.ResponseWriter, r *http.Request) {
+		site.codewalkHandler(w, r)
+	})
+}
+
+// Codewalk is the top-level type used to parse the codewalk XML files.
+type Codewalk struct {
+	Title string      `xml:"title,attr"`
+	File  []string    `xml:"file"`
+	Step  []*Codestep `xml:"step"`
+}
+
+// Codestep is a single step of a codewalk.
+type Codestep struct {
+	// Parsed from XML
+	Src         string        `xml:"src,attr"`
+	Title       string        `xml:"title,attr"`
+	XML         string        `xml:",innerxml"`
+	Description template.HTML `xml:"-"`
+
+	// Derived from Src by resolveStep.
+	Err    error
+	File   string
+	Lo, Hi int // line numbers, 1-indexed, inclusive
+}
+
+// codewalkHandler serves either a single codewalk (when the requested path
+// ends in .xml) or, for a directory, the regular directory listing, which
+// includes the codewalks in that directory. Requests carrying a fileprint
+// parameter are handed to serveCodewalkFile.
+func (s *Site) codewalkHandler(w http.ResponseWriter, r *http.Request) {
+	relpath := strings.TrimPrefix(r.URL.Path, "/codewalk/")
+	if relpath == "" {
+		relpath = "."
+	}
+
+	if fileprint := r.FormValue("fileprint"); fileprint != "" {
+		s.serveCodewalkFile(w, r)
+		return
+	}
+
+	fi, err := fs.Stat(s.FS, relpath)
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	if fi.IsDir() {
+		if _, err := s.dirList(w, relpath); err != nil {
+			log.Errorln(err)
+			http.Error(w, err.Error(), 500)
+		}
+		return
+	}
+	if path.Ext(relpath) != ".xml" {
+		http.Error(w, "not a codewalk", 404)
+		return
+	}
+
+	cw, err := s.loadCodewalk(relpath)
+	if err != nil {
+		log.Errorln(err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	tmpl, err := currentLayoutTemplate().Clone()
+	if err != nil {
+		log.Errorln(err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl, err = tmpl.ParseFS(s.FS, path.Join(s.base, "codewalk.tmpl"))
+	if err != nil {
+		log.Errorln(err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if err := tmpl.Execute(w, cw); err != nil {
+		log.Errorln(err)
+	}
+}
+
+// serveCodewalkFile streams lines lo..hi of the requested file, as built
+// by fileprint. It backs the AJAX step-switching in the two-pane codewalk
+// view.
+func (s *Site) serveCodewalkFile(w http.ResponseWriter, r *http.Request) {
+	relpath := r.FormValue("fileprint")
+	lo, _ := strconv.Atoi(r.FormValue("lo"))
+	hi, _ := strconv.Atoi(r.FormValue("hi"))
+
+	data, err := s.fileprint(relpath, lo, hi)
+	if err != nil {
+		log.Errorln(err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Write(data)
+}
+
+// loadCodewalk reads and parses the codewalk XML file at relpath (relative
+// to s.FS) and resolves each step's src reference into concrete line
+// numbers within its file.
+func (s *Site) loadCodewalk(relpath string) (*Codewalk, error) {
+	f, err := s.FS.Open(relpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cw := new(Codewalk)
+	if err := xml.NewDecoder(f).Decode(cw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", relpath, err)
+	}
+
+	for _, step := range cw.Step {
+		step.Description = template.HTML(step.XML)
+		if err := s.resolveStep(step); err != nil {
+			step.Err = err
+		}
+	}
+	return cw, nil
+}
+
+// srcRE matches a step's src attribute: path/to/file.go[:something].
+var srcRE = regexp.MustCompile(`^(.*?)(?::(.*))?$`)
+
+// resolveStep turns a Codestep's Src ("path/to/file.go:/regexp/" or
+// "path/to/file.go:12-20") into a concrete (File, Lo, Hi).
+func (s *Site) resolveStep(step *Codestep) error {
+	m := srcRE.FindStringSubmatch(step.Src)
+	if m == nil {
+		return fmt.Errorf("malformed src attribute: %q", step.Src)
+	}
+	step.File = m[1]
+	addr := m[2]
+
+	clean := path.Clean(step.File)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("src %q escapes content root", step.Src)
+	}
+
+	data, err := fs.ReadFile(s.FS, step.File)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+
+	if addr == "" {
+		step.Lo, step.Hi = 1, len(lines)
+		return nil
+	}
+	if lo, hi, ok := parseLineRange(addr); ok {
+		step.Lo, step.Hi = lo, hi
+		return nil
+	}
+	if strings.HasPrefix(addr, "/") && strings.HasSuffix(addr, "/") {
+		pat := addr[1 : len(addr)-1]
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return fmt.Errorf("bad regexp %q: %v", pat, err)
+		}
+		trimmedPat := strings.TrimRight(pat, " \t")
+		for i, line := range lines {
+			if re.MatchString(line) {
+				lo, hi := i+1, i+1
+				if strings.HasSuffix(trimmedPat, "{") || strings.HasSuffix(trimmedPat, "(") {
+					hi = matchBlock(lines, i)
+				}
+				step.Lo, step.Hi = lo, hi
+				return nil
+			}
+		}
+		return fmt.Errorf("no match for %s in %s", re, step.File)
+	}
+	return fmt.Errorf("malformed src address: %q", addr)
+}
+
+// parseLineRange parses "12-20" or "12" into a 1-indexed, inclusive range.
+func parseLineRange(s string) (lo, hi int, ok bool) {
+	parts := strings.SplitN(s, "-", 2)
+	lo, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	if len(parts) == 1 {
+		return lo, lo, true
+	}
+	hi, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// matchBlock expands from the 0-indexed line start (which ends in '{' or
+// '(') to the 0-indexed line that closes the matching brace or paren,
+// returning its 1-indexed line number.
+func matchBlock(lines []string, start int) int {
+	open := lines[start][strings.LastIndexAny(lines[start], "{(")]
+	shut := byte('}')
+	if open == '(' {
+		shut = ')'
+	}
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		for _, c := range lines[i] {
+			switch byte(c) {
+			case open:
+				depth++
+			case shut:
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	}
+	return len(lines)
+}
+
+// fileprint returns the [lo, hi] (1-indexed, inclusive) line range of the
+// file at relpath as an HTML fragment: the lines are HTML-escaped inside a
+// <pre> element. No syntax highlighting is applied.
+func (s *Site) fileprint(relpath string, lo, hi int) ([]byte, error) {
+	data, err := fs.ReadFile(s.FS, relpath)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(data), "\n")
+	if lo < 1 {
+		lo = 1
+	}
+	if hi < lo || hi > len(lines) {
+		hi = len(lines)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<pre>")
+	for i := lo - 1; i < hi; i++ {
+		template.HTMLEscape(&buf, []byte(lines[i]))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("</pre>")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// stubTemplates are the minimal set newOSSite needs to initialize
+// successfully; testSite supplies them so callers only need to write the
+// content files their test actually exercises.
+var stubTemplates = map[string]string{
+	"layout.tmpl":  `{{template "content" .}}`,
+	"dir.tmpl":     `{{define "content"}}dirlist:{{.Path}}{{end}}`,
+	"action.tmpl":  "",
+	"slides.tmpl":  "",
+	"article.tmpl": "",
+}
+
+func testSite(t *testing.T, files map[string]string) *Site {
+	dir := t.TempDir()
+	for name, contents := range stubTemplates {
+		if _, ok := files[name]; !ok {
+			files[name] = contents
+		}
+	}
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newOSSite(dir)
+}
+
+// TestNewOSSiteInitializesTemplates guards against newOSSite leaving
+// dirListTemplate/contentTemplate/layoutTemplate nil: a Site must be
+// immediately usable without requiring -live.
+func TestNewOSSiteInitializesTemplates(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"intro.slide": "Intro\n\n* Section\n\ntext\n",
+	})
+
+	var buf bytes.Buffer
+	if isDir, err := s.dirList(&buf, "."); err != nil || !isDir {
+		t.Fatalf("dirList(\".\") = isDir=%v, err=%v", isDir, err)
+	}
+	if buf.Len() == 0 {
+		t.Error("dirList wrote nothing")
+	}
+}
+
+func TestResolveStepRegexp(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"pkg/foo.go": "package pkg\n\nfunc Foo() {\n\treturn\n}\n",
+	})
+
+	step := &Codestep{Src: `pkg/foo.go:/func Foo\(\) {/`}
+	if err := s.resolveStep(step); err != nil {
+		t.Fatal(err)
+	}
+	if step.File != "pkg/foo.go" {
+		t.Errorf("File = %q, want pkg/foo.go", step.File)
+	}
+	if step.Lo != 3 || step.Hi != 5 {
+		t.Errorf("Lo,Hi = %d,%d, want 3,5 (balanced to closing brace)", step.Lo, step.Hi)
+	}
+}
+
+func TestResolveStepRegexpNoExpand(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"pkg/foo.go": "package pkg\n\nfunc Foo() {\n\treturn\n}\n",
+	})
+
+	// The pattern doesn't end in '{' or '(', even though the matched
+	// line does, so the match should not expand to the closing brace.
+	step := &Codestep{Src: `pkg/foo.go:/func Foo/`}
+	if err := s.resolveStep(step); err != nil {
+		t.Fatal(err)
+	}
+	if step.Lo != 3 || step.Hi != 3 {
+		t.Errorf("Lo,Hi = %d,%d, want 3,3 (no expansion)", step.Lo, step.Hi)
+	}
+}
+
+func TestResolveStepLineRange(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"pkg/foo.go": "line1\nline2\nline3\nline4\n",
+	})
+
+	step := &Codestep{Src: "pkg/foo.go:2-3"}
+	if err := s.resolveStep(step); err != nil {
+		t.Fatal(err)
+	}
+	if step.Lo != 2 || step.Hi != 3 {
+		t.Errorf("Lo,Hi = %d,%d, want 2,3", step.Lo, step.Hi)
+	}
+}
+
+func TestResolveStepOutOfTree(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"pkg/foo.go": "line1\n",
+	})
+
+	step := &Codestep{Src: "../etc/passwd:1-1"}
+	if err := s.resolveStep(step); err == nil {
+		t.Fatal("expected error for out-of-tree src reference, got nil")
+	}
+}
@@ -7,29 +7,30 @@ package main
 import (
 	"html/template"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	log "minilog"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
 	"sort"
 	"strings"
+	"sync"
 
 	"present"
 )
 
 func init() {
-	http.HandleFunc("/", dirHandler)
+	// site is assigned by main after flags are parsed, so dispatch through
+	// a closure rather than binding the method value now.
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		site.dirHandler(w, r)
+	})
 }
 
-// dirHandler serves a directory listing for the requested path, rooted at basePath.
-func dirHandler(w http.ResponseWriter, r *http.Request) {
-	if strings.HasPrefix(r.URL.Path, "/minimega.git") {
-		// modify host to github, keep rest of the URL intact (including query params)
-		url := r.URL
-		url.Host = "github.com"
-		url.Path = "/sandia-minimega" + url.Path
-		http.Redirect(w, r, url.String(), 301)
+// dirHandler serves a directory listing for the requested path, rooted at
+// the Site's filesystem.
+func (s *Site) dirHandler(w http.ResponseWriter, r *http.Request) {
+	if target, status, ok := rewrites.rewrite(r); ok {
+		http.Redirect(w, r, target, status)
 		return
 	}
 
@@ -37,18 +38,27 @@ func dirHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", 404)
 		return
 	}
-	const base = "."
-	name := filepath.Join(base, r.URL.Path)
+	if s.live {
+		if err := s.initTemplates(); err != nil {
+			log.Errorln(err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" {
+		name = "."
+	}
 
 	if isDoc(name) {
-		err := renderDoc(w, name)
+		err := s.renderDoc(w, name)
 		if err != nil {
 			log.Errorln(err)
 			http.Error(w, err.Error(), 500)
 		}
 		return
 	}
-	if isDir, err := dirList(w, name); err != nil {
+	if isDir, err := s.dirList(w, name); err != nil {
 		log.Errorln(err)
 		http.Error(w, err.Error(), 500)
 		return
@@ -57,22 +67,26 @@ func dirHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// try to render .html as a template
-	if filepath.Ext(name) == ".html" {
-		if err := renderHTML(w, name); err != nil {
+	if path.Ext(name) == ".html" {
+		if err := s.renderHTML(w, name); err != nil {
 			log.Errorln(err)
 			http.Error(w, err.Error(), 500)
 		}
 		return
 	}
 
-	http.FileServer(http.Dir(*f_root)).ServeHTTP(w, r)
+	http.FileServer(http.FS(s.FS)).ServeHTTP(w, r)
 }
 
-func isDoc(path string) bool {
-	_, ok := contentTemplate[filepath.Ext(path)]
-	return ok
+func isDoc(p string) bool {
+	return currentContentTemplate(path.Ext(p)) != nil
 }
 
+// tmplMu guards dirListTemplate, contentTemplate and layoutTemplate: in
+// -live mode initTemplates reassigns them from a request's goroutine,
+// while concurrent requests read them via the accessors below.
+var tmplMu sync.RWMutex
+
 var (
 	// dirListTemplate holds the front page template.
 	dirListTemplate *template.Template
@@ -85,58 +99,89 @@ var (
 	layoutTemplate *template.Template
 )
 
-func initTemplates(base string) error {
+func currentDirListTemplate() *template.Template {
+	tmplMu.RLock()
+	defer tmplMu.RUnlock()
+	return dirListTemplate
+}
+
+func currentContentTemplate(ext string) *template.Template {
+	tmplMu.RLock()
+	defer tmplMu.RUnlock()
+	return contentTemplate[ext]
+}
+
+func currentLayoutTemplate() *template.Template {
+	tmplMu.RLock()
+	defer tmplMu.RUnlock()
+	return layoutTemplate
+}
+
+// initTemplates parses the server's templates out of fsys, rooted at
+// base, and publishes them atomically under tmplMu so concurrent
+// requests never observe a partially-replaced set.
+func initTemplates(fsys fs.FS, base string) error {
+	present.Play = newPlayFunc()
+
 	// Locate the template file.
-	actionTmpl := filepath.Join(base, "action.tmpl")
+	actionTmpl := path.Join(base, "action.tmpl")
 
-	contentTemplate = make(map[string]*template.Template)
+	newContentTemplate := make(map[string]*template.Template)
 
 	for ext, contentTmpl := range map[string]string{
 		".slide":   "slides.tmpl",
 		".article": "article.tmpl",
 	} {
-		contentTmpl = filepath.Join(base, contentTmpl)
+		contentTmpl = path.Join(base, contentTmpl)
 
 		// Read and parse the input.
 		tmpl := present.Template()
 		tmpl = tmpl.Funcs(template.FuncMap{"playable": executable})
-		if _, err := tmpl.ParseFiles(actionTmpl, contentTmpl); err != nil {
+		if _, err := tmpl.ParseFS(fsys, actionTmpl, contentTmpl); err != nil {
 			return err
 		}
-		contentTemplate[ext] = tmpl
+		newContentTemplate[ext] = tmpl
 	}
 
-	var err error
-	layoutTemplate, err = template.ParseFiles(filepath.Join(base, "layout.tmpl"))
+	newLayoutTemplate, err := template.ParseFS(fsys, path.Join(base, "layout.tmpl"))
 	if err != nil {
 		return err
 	}
 
-	dirListTemplate, err = template.ParseFiles(filepath.Join(base, "dir.tmpl"))
+	newDirListTemplate, err := template.ParseFS(fsys, path.Join(base, "dir.tmpl"))
 	if err != nil {
 		return err
 	}
 
-	tmpl, err := layoutTemplate.Clone()
+	tmpl, err := newLayoutTemplate.Clone()
 	if err != nil {
 		return err
 	}
 
-	dirListTemplate, err = dirListTemplate.AddParseTree("layout.tmpl", tmpl.Tree)
-	return err
+	newDirListTemplate, err = newDirListTemplate.AddParseTree("layout.tmpl", tmpl.Tree)
+	if err != nil {
+		return err
+	}
+
+	tmplMu.Lock()
+	contentTemplate = newContentTemplate
+	layoutTemplate = newLayoutTemplate
+	dirListTemplate = newDirListTemplate
+	tmplMu.Unlock()
+	return nil
 }
 
 // renderDoc reads the present file, gets its template representation,
 // and executes the template, sending output to w.
-func renderDoc(w io.Writer, docFile string) error {
+func (s *Site) renderDoc(w io.Writer, docFile string) error {
 	// Read the input and build the doc structure.
-	doc, err := parse(docFile, 0)
+	doc, err := s.parse(docFile, 0)
 	if err != nil {
 		return err
 	}
 
 	// Find which template should be executed.
-	tmpl := contentTemplate[filepath.Ext(docFile)]
+	tmpl := currentContentTemplate(path.Ext(docFile))
 
 	// Execute the template.
 	return doc.Render(w, tmpl)
@@ -144,16 +189,15 @@ func renderDoc(w io.Writer, docFile string) error {
 
 // renderHTML parses the html file as a template and tries to execute it with
 // layoutTemplate. Reparses the html file each time.
-func renderHTML(w io.Writer, name string) error {
+func (s *Site) renderHTML(w io.Writer, name string) error {
 	log.Info("renderHTML: %v", name)
 
-	f := filepath.Join(*f_root, name)
-	tmpl, err := layoutTemplate.Clone()
+	tmpl, err := currentLayoutTemplate().Clone()
 	if err != nil {
 		return err
 	}
 
-	tmpl, err = tmpl.ParseFiles(f)
+	tmpl, err = tmpl.ParseFS(s.FS, name)
 	if err != nil {
 		return err
 	}
@@ -161,8 +205,8 @@ func renderHTML(w io.Writer, name string) error {
 	return tmpl.Execute(w, nil)
 }
 
-func parse(name string, mode present.ParseMode) (*present.Doc, error) {
-	f, err := os.Open(filepath.Join(*f_root, name))
+func (s *Site) parse(name string, mode present.ParseMode) (*present.Doc, error) {
+	f, err := s.FS.Open(name)
 	if err != nil {
 		return nil, err
 	}
@@ -175,20 +219,15 @@ func parse(name string, mode present.ParseMode) (*present.Doc, error) {
 // presentation title in the listing.
 // If the given path is not a directory, it returns (isDir == false, err == nil)
 // and writes nothing to w.
-func dirList(w io.Writer, name string) (isDir bool, err error) {
-	f, err := os.Open(filepath.Join(*f_root, name))
-	if err != nil {
-		return false, err
-	}
-	defer f.Close()
-	fi, err := f.Stat()
+func (s *Site) dirList(w io.Writer, name string) (isDir bool, err error) {
+	fi, err := fs.Stat(s.FS, name)
 	if err != nil {
 		return false, err
 	}
 	if isDir = fi.IsDir(); !isDir {
 		return false, nil
 	}
-	fis, err := f.Readdir(0)
+	fis, err := fs.ReadDir(s.FS, name)
 	if err != nil {
 		return false, err
 	}
@@ -200,30 +239,37 @@ func dirList(w io.Writer, name string) (isDir bool, err error) {
 		}
 		e := dirEntry{
 			Name: fi.Name(),
-			Path: filepath.ToSlash(filepath.Join(name, fi.Name())),
+			Path: path.Join(name, fi.Name()),
 		}
 		// If there's an index.html, send that back and bail out
 		if fi.Name() == "index.html" {
 			// returning true is naughty but whatever
-			return true, renderHTML(w, e.Path)
+			return true, s.renderHTML(w, e.Path)
 		}
 
-		if fi.IsDir() && showDir(e) {
+		if fi.IsDir() && s.showDir(e) {
 			d.Dirs = append(d.Dirs, e)
 			continue
 		}
 		if isDoc(e.Name) {
-			if p, err := parse(e.Path, present.TitlesOnly); err != nil {
+			if p, err := s.parse(e.Path, present.TitlesOnly); err != nil {
 				log.Errorln(err)
 			} else {
 				e.Title = p.Title
 			}
-			switch filepath.Ext(e.Path) {
+			switch path.Ext(e.Path) {
 			case ".article":
 				d.Articles = append(d.Articles, e)
 			case ".slide":
 				d.Slides = append(d.Slides, e)
 			}
+		} else if isCodewalk(e.Path) {
+			if cw, err := s.loadCodewalk(e.Path); err != nil {
+				log.Errorln(err)
+			} else {
+				e.Title = cw.Title
+			}
+			d.Codewalks = append(d.Codewalks, e)
 		} else if showFile(e.Name) {
 			d.Other = append(d.Other, e)
 		}
@@ -234,13 +280,14 @@ func dirList(w io.Writer, name string) (isDir bool, err error) {
 	sort.Sort(d.Dirs)
 	sort.Sort(d.Slides)
 	sort.Sort(d.Articles)
+	sort.Sort(d.Codewalks)
 	sort.Sort(d.Other)
-	return true, dirListTemplate.Execute(w, d)
+	return true, currentDirListTemplate().Execute(w, d)
 }
 
 // showFile reports whether the given file should be displayed in the list.
 func showFile(n string) bool {
-	switch filepath.Ext(n) {
+	switch path.Ext(n) {
 	case ".pdf":
 	case ".html":
 	case ".go":
@@ -251,14 +298,14 @@ func showFile(n string) bool {
 }
 
 // showDir reports whether the given directory should be displayed in the list.
-func showDir(e dirEntry) bool {
+func (s *Site) showDir(e dirEntry) bool {
 	n := e.Name
 	if len(n) > 0 && (n[0] == '.' || n[0] == '_') || n == "present" {
 		return false
 	}
 
 	// make sure the directory has at least one displayed file
-	files, err := ioutil.ReadDir(filepath.Join(*f_root, e.Path))
+	files, err := fs.ReadDir(s.FS, e.Path)
 	if err != nil {
 		return false
 	}
@@ -272,8 +319,14 @@ func showDir(e dirEntry) bool {
 }
 
 type dirListData struct {
-	Path                          string
-	Dirs, Slides, Articles, Other dirEntrySlice
+	Path                                     string
+	Dirs, Slides, Articles, Codewalks, Other dirEntrySlice
+}
+
+// isCodewalk reports whether the given path looks like a codewalk
+// (a .xml file) next to the .slide and .article content.
+func isCodewalk(p string) bool {
+	return path.Ext(p) == ".xml"
 }
 
 type dirEntry struct {
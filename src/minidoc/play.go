@@ -0,0 +1,153 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// This file implements the -play-mode=http deployment, where playable
+// code blocks in .slide/.article documents are compiled and run by a
+// remote compiler service (by default play.golang.org) instead of
+// present's default of spawning local processes over its own socket.
+// This lets the doc site run in hosted/containerized environments where
+// executing arbitrary snippets locally is unacceptable.
+
+import (
+	"flag"
+	"io"
+	log "minilog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"present"
+)
+
+var (
+	f_playMode        = flag.String("play-mode", "local", "playground execution mode: local (present's own socket) or http (relay to -play-url)")
+	f_playURL         = flag.String("play-url", "https://play.golang.org", "playground compile/share backend used in -play-mode=http")
+	f_playTrustHeader = flag.String("play-trust-header", "", "header carrying the real client IP (e.g. X-Forwarded-For), trusted for the -play-mode=http rate limiter when running behind a reverse proxy; empty uses RemoteAddr directly")
+)
+
+const (
+	playMaxBody    = 64 << 10 // maximum relayed request body size
+	playTimeout    = 10 * time.Second
+	playRateN      = 5               // requests
+	playRateEach   = 2 * time.Second // per this long, per source IP
+	playSweepEvery = 1024            // opportunistically evict expired rate-limiter entries every this many requests
+)
+
+// newPlayFunc returns the present.PlayFunc to install for the configured
+// -play-mode: present's local socket executor, or a relay to -play-url.
+func newPlayFunc() present.PlayFunc {
+	if *f_playMode != "http" {
+		return nil // nil tells present to keep its local executor
+	}
+
+	limiter := newIPRateLimiter(playRateN, playRateEach)
+	client := &http.Client{Timeout: playTimeout}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := clientIP(r, *f_playTrustHeader)
+		if !limiter.Allow(host) {
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, playMaxBody)
+
+		req, err := http.NewRequest(r.Method, strings.TrimRight(*f_playURL, "/")+r.URL.Path, r.Body)
+		if err != nil {
+			log.Errorln(err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		req.Header = r.Header.Clone()
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Errorln(err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		for k, vs := range resp.Header {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}
+}
+
+// clientIP returns the address used to key the per-IP rate limiter. If
+// trustHeader is set (e.g. "X-Forwarded-For"), its first entry is trusted
+// as the real client address, for deployments running -play-mode=http
+// behind a reverse proxy where RemoteAddr is always the proxy's own
+// address. Otherwise it falls back to RemoteAddr with the port stripped.
+func clientIP(r *http.Request, trustHeader string) string {
+	if trustHeader != "" {
+		if v := r.Header.Get(trustHeader); v != "" {
+			if i := strings.IndexByte(v, ','); i >= 0 {
+				v = v[:i]
+			}
+			return strings.TrimSpace(v)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ipRateLimiter caps each source IP to n requests per window, using a
+// simple fixed-window counter per IP. Expired entries are swept out
+// opportunistically so the map doesn't grow unboundedly over the life of
+// a long-running process.
+type ipRateLimiter struct {
+	mu     sync.Mutex
+	n      int
+	window time.Duration
+	seen   map[string]*ipWindow
+	calls  int
+}
+
+type ipWindow struct {
+	start time.Time
+	count int
+}
+
+func newIPRateLimiter(n int, window time.Duration) *ipRateLimiter {
+	return &ipRateLimiter{n: n, window: window, seen: make(map[string]*ipWindow)}
+}
+
+func (l *ipRateLimiter) Allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := timeNow()
+	w, ok := l.seen[ip]
+	if !ok || now.Sub(w.start) > l.window {
+		w = &ipWindow{start: now}
+		l.seen[ip] = w
+	}
+	w.count++
+
+	l.calls++
+	if l.calls >= playSweepEvery {
+		l.calls = 0
+		for k, ww := range l.seen {
+			if now.Sub(ww.start) > l.window {
+				delete(l.seen, k)
+			}
+		}
+	}
+	return w.count <= l.n
+}
+
+// timeNow is a var so tests can fake the clock.
+var timeNow = time.Now
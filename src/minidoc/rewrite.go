@@ -0,0 +1,131 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// This file generalizes the old hard-coded /minimega.git -> GitHub
+// redirect into a small rewrite engine, configured from a rewrites.json
+// file: an ordered list of {match, status, target, preserve_query}
+// rules. This lets downstream forks host their own doc server, and add
+// shortcuts like /issues/<n> or /rfc/<id>, without patching Go code.
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"sync/atomic"
+)
+
+var f_rewrites = flag.String("rewrites", "", "path to a rewrites.json rule file; empty uses the built-in default")
+
+// rewriteRule is one entry of a rewrites.json file.
+type rewriteRule struct {
+	Match         string `json:"match"`
+	Status        int    `json:"status"`
+	Target        string `json:"target"`
+	PreserveQuery bool   `json:"preserve_query"`
+
+	re   *regexp.Regexp
+	hits uint64 // accessed via sync/atomic
+}
+
+// rewriteEngine evaluates an ordered list of rules against incoming
+// request paths, first match wins.
+type rewriteEngine struct {
+	rules []*rewriteRule
+}
+
+// defaultRewrites preserves the redirect minidoc has always issued for
+// /minimega.git, for deployments that don't supply -rewrites.
+var defaultRewrites = []*rewriteRule{
+	{Match: `^/minimega\.git(.*)$`, Status: 301, Target: "https://github.com/sandia-minimega/minimega.git$1", PreserveQuery: true},
+}
+
+// rewrites is the engine in effect for the running server.
+var rewrites *rewriteEngine
+
+func init() {
+	http.HandleFunc("/debug/rewrites", debugRewritesHandler)
+}
+
+// loadRewrites loads and compiles the rules at path. If path is empty it
+// compiles defaultRewrites instead.
+func loadRewrites(path string) (*rewriteEngine, error) {
+	var rules []*rewriteRule
+	if path == "" {
+		rules = defaultRewrites
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+	}
+
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %v", r.Match, err)
+		}
+		r.re = re
+	}
+	return &rewriteEngine{rules: rules}, nil
+}
+
+// rewrite returns the target URL and status code for the first rule
+// matching r's path, or ok == false if no rule matches.
+func (e *rewriteEngine) rewrite(r *http.Request) (target string, status int, ok bool) {
+	if e == nil {
+		return "", 0, false
+	}
+	for _, rule := range e.rules {
+		m := rule.re.FindStringSubmatchIndex(r.URL.Path)
+		if m == nil {
+			continue
+		}
+		atomic.AddUint64(&rule.hits, 1)
+
+		target := string(rule.re.ExpandString(nil, rule.Target, r.URL.Path, m))
+		if rule.PreserveQuery && r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		return target, rule.Status, true
+	}
+	return "", 0, false
+}
+
+// debugRewritesHandler lists the active rewrite rules and their hit
+// counters, for operators diagnosing a downstream fork's rewrites.json.
+func debugRewritesHandler(w http.ResponseWriter, r *http.Request) {
+	type row struct {
+		Match         string `json:"match"`
+		Status        int    `json:"status"`
+		Target        string `json:"target"`
+		PreserveQuery bool   `json:"preserve_query"`
+		Hits          uint64 `json:"hits"`
+	}
+
+	var rows []row
+	if rewrites != nil {
+		for _, rule := range rewrites.rules {
+			rows = append(rows, row{
+				Match:         rule.Match,
+				Status:        rule.Status,
+				Target:        rule.Target,
+				PreserveQuery: rule.PreserveQuery,
+				Hits:          atomic.LoadUint64(&rule.hits),
+			})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Match < rows[j].Match })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
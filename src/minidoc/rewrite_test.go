@@ -0,0 +1,82 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteDefault(t *testing.T) {
+	e, err := loadRewrites("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/minimega.git/info/refs?service=git-upload-pack", nil)
+	target, status, ok := e.rewrite(r)
+	if !ok {
+		t.Fatal("expected the default rule to match /minimega.git")
+	}
+	if status != 301 {
+		t.Errorf("status = %d, want 301", status)
+	}
+	want := "https://github.com/sandia-minimega/minimega.git/info/refs?service=git-upload-pack"
+	if target != want {
+		t.Errorf("target = %q, want %q", target, want)
+	}
+}
+
+func TestRewriteNoMatch(t *testing.T) {
+	e, err := loadRewrites("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/slides/intro.slide", nil)
+	if _, _, ok := e.rewrite(r); ok {
+		t.Error("expected no rule to match an ordinary content path")
+	}
+}
+
+// TestLoadRewritesDoesNotMutateDefaults guards against loadRewrites
+// aliasing defaultRewrites: unmarshaling a custom -rewrites file must
+// never corrupt the built-in fallback rule set used by later calls to
+// loadRewrites("").
+func TestLoadRewritesDoesNotMutateDefaults(t *testing.T) {
+	wantMatch := defaultRewrites[0].Match
+
+	custom := []rewriteRule{
+		{Match: `^/issues/(\d+)$`, Status: 302, Target: "https://example.com/issues/$1"},
+	}
+	data, err := json.Marshal(custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "rewrites.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadRewrites(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if defaultRewrites[0].Match != wantMatch {
+		t.Errorf("defaultRewrites[0].Match = %q after loading a custom config, want unchanged %q", defaultRewrites[0].Match, wantMatch)
+	}
+
+	e, err := loadRewrites("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/minimega.git/info/refs", nil)
+	if _, _, ok := e.rewrite(r); !ok {
+		t.Error("expected the default rule to still match /minimega.git after a custom config was loaded")
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// A full-text search index over the .slide and .article content tree,
+// exposed at /search. The index is built once at startup, before
+// newOSSite or newEmbedSite returns, and rebuilt in the background on a configurable
+// interval so editors don't need to restart the server to pick up new or
+// changed content.
+
+import (
+	"encoding/json"
+	"flag"
+	"io/fs"
+	"math"
+	log "minilog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"present"
+)
+
+var f_reindex = flag.Duration("reindex", 5*time.Minute, "how often to rebuild the search index (0 disables periodic reindexing)")
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// posting is one occurrence of a token in a document.
+type posting struct {
+	Doc     string // path to the .slide or .article, relative to the site root
+	Slide   int    // 1-indexed slide/section number within Doc
+	Section string // section title, for display
+	Snippet string // surrounding text, for display
+	tf      int    // term frequency within this (Doc, Slide)
+}
+
+// searchIndex is an in-memory inverted index: token -> postings. It is
+// rebuilt wholesale on reindex and swapped in under a write lock so
+// concurrent readers never see a partially built index.
+type searchIndex struct {
+	mu       sync.RWMutex
+	postings map[string][]posting
+	docLen   map[string]int // tokens per (Doc, Slide) key, for BM25
+	avgLen   float64
+	n        int // number of documents (slides/sections) indexed
+}
+
+var searchIdx = &searchIndex{}
+
+func init() {
+	http.HandleFunc("/search", searchHandler)
+}
+
+func docKey(doc string, slide int) string {
+	return doc + "#" + strconv.Itoa(slide)
+}
+
+// buildSearchIndex walks fsys for .slide and .article files and returns a
+// freshly built index. It never touches searchIdx directly so callers can
+// build off the hot path and swap it in atomically.
+func buildSearchIndex(fsys fs.FS) (*searchIndex, error) {
+	idx := &searchIndex{
+		postings: make(map[string][]posting),
+		docLen:   make(map[string]int),
+	}
+
+	var totalLen int
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isDoc(p) {
+			return nil
+		}
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		doc, err := present.Parse(f, p, 0)
+		if err != nil {
+			log.Errorln(err)
+			return nil
+		}
+		for i, section := range doc.Sections {
+			key := docKey(p, i+1)
+			text := sectionText(section)
+			toks := tokenize(text)
+
+			counts := make(map[string]int)
+			for _, t := range toks {
+				counts[t]++
+			}
+			for t, c := range counts {
+				idx.postings[t] = append(idx.postings[t], posting{
+					Doc:     p,
+					Slide:   i + 1,
+					Section: sectionTitle(section),
+					Snippet: snippet(text, 160),
+					tf:      c,
+				})
+			}
+			idx.docLen[key] = len(toks)
+			totalLen += len(toks)
+			idx.n++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if idx.n > 0 {
+		idx.avgLen = float64(totalLen) / float64(idx.n)
+	}
+	return idx, nil
+}
+
+// reindex rebuilds the search index from fsys and swaps it into searchIdx.
+func reindex(fsys fs.FS) {
+	idx, err := buildSearchIndex(fsys)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	searchIdx.mu.Lock()
+	searchIdx.postings = idx.postings
+	searchIdx.docLen = idx.docLen
+	searchIdx.avgLen = idx.avgLen
+	searchIdx.n = idx.n
+	searchIdx.mu.Unlock()
+}
+
+// startIndexer builds the index once and, if interval > 0, periodically
+// rebuilds it in the background for the lifetime of the process.
+func startIndexer(fsys fs.FS, interval time.Duration) {
+	reindex(fsys)
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			reindex(fsys)
+		}
+	}()
+}
+
+var wordRE = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "has": true, "in": true,
+	"is": true, "it": true, "its": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+// tokenize splits s into lowercase letter/digit runs, dropping stopwords.
+func tokenize(s string) []string {
+	words := wordRE.FindAllString(strings.ToLower(s), -1)
+	toks := words[:0]
+	for _, w := range words {
+		if !stopwords[w] {
+			toks = append(toks, w)
+		}
+	}
+	return toks
+}
+
+// searchResult is one ranked hit, ready for rendering.
+type searchResult struct {
+	Doc     string
+	Slide   int
+	Title   string
+	Snippet string
+	Score   float64
+}
+
+// search ranks documents against query using BM25 over the postings for
+// each query token, returning results best-first.
+func (idx *searchIndex) search(query string) []searchResult {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	terms := tokenize(query)
+	if len(terms) == 0 || idx.n == 0 {
+		return nil
+	}
+
+	scores := make(map[string]float64)
+	results := make(map[string]searchResult)
+	for _, term := range terms {
+		plist := idx.postings[term]
+		idf := bm25IDF(idx.n, len(plist))
+		for _, p := range plist {
+			key := docKey(p.Doc, p.Slide)
+			dl := float64(idx.docLen[key])
+			score := idf * float64(p.tf) * (bm25K1 + 1) /
+				(float64(p.tf) + bm25K1*(1-bm25B+bm25B*dl/idx.avgLen))
+			scores[key] += score
+			if _, ok := results[key]; !ok {
+				results[key] = searchResult{Doc: p.Doc, Slide: p.Slide, Title: p.Section, Snippet: p.Snippet}
+			}
+		}
+	}
+
+	out := make([]searchResult, 0, len(scores))
+	for key, score := range scores {
+		r := results[key]
+		r.Score = score
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Doc < out[j].Doc
+	})
+	return out
+}
+
+// bm25IDF computes the BM25 inverse document frequency term for a token
+// appearing in df of n total documents.
+func bm25IDF(n, df int) float64 {
+	if df == 0 {
+		return 0
+	}
+	x := (float64(n)-float64(df)+0.5)/(float64(df)+0.5) + 1
+	if x <= 0 {
+		return 0
+	}
+	return math.Log(x)
+}
+
+// searchHandler serves /search, returning an HTML results page by
+// default or, with &format=json, a JSON array of results.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.FormValue("q")
+	results := searchIdx.search(q)
+
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+
+	data := struct {
+		Query   string
+		Results []searchResult
+	}{Query: q, Results: results}
+
+	tmpl, err := currentLayoutTemplate().Clone()
+	if err != nil {
+		log.Errorln(err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tmpl, err = tmpl.ParseFS(site.FS, "search.tmpl")
+	if err != nil {
+		log.Errorln(err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Errorln(err)
+	}
+}
+
+// sectionText, sectionTitle and snippet adapt present.Doc's section type
+// (which varies across present.Elem implementations) into plain text for
+// indexing and display.
+func sectionText(section present.Section) string {
+	var sb strings.Builder
+	sb.WriteString(section.Title)
+	for _, elem := range section.Elem {
+		if t, ok := elem.(present.Text); ok {
+			for _, line := range t.Lines {
+				sb.WriteString(" ")
+				sb.WriteString(line)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func sectionTitle(section present.Section) string {
+	return section.Title
+}
+
+func snippet(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
@@ -0,0 +1,51 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("The Quick, Brown Fox-Jumps over 2 lazy dogs.")
+	want := []string{"quick", "brown", "fox", "jumps", "over", "2", "lazy", "dogs"}
+	if len(got) != len(want) {
+		t.Fatalf("tokenize() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("tokenize()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.slide": {Data: []byte("Networking Talk\n\n* Intro\n\nminimega supports overlay networking and VLANs.\n\n* Details\n\nThe networking stack handles VLAN trunking.\n")},
+		"b.slide": {Data: []byte("Storage Talk\n\n* Intro\n\nminimega mounts disk images over a network share.\n")},
+	}
+
+	idx, err := buildSearchIndex(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.n == 0 {
+		t.Fatal("expected a non-empty index")
+	}
+
+	results := idx.search("networking")
+	if len(results) == 0 {
+		t.Fatal("expected at least one result for \"networking\"")
+	}
+	if results[0].Doc != "a.slide" {
+		t.Errorf("top result = %s, want a.slide (b.slide only has \"network\")", results[0].Doc)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("results not sorted best-first: %v", results)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"embed"
+	"flag"
+	"io/fs"
+	log "minilog"
+	"os"
+)
+
+// f_live, when set, causes templates to be re-parsed from site.FS on every
+// request instead of once at startup. Useful while authoring content. Only
+// a Site from newOSSite honors it; newEmbedSite ignores it.
+var f_live = flag.Bool("live", false, "re-parse templates on every request")
+
+//go:embed layout.tmpl dir.tmpl action.tmpl slides.tmpl article.tmpl codewalk.tmpl search.tmpl misc
+var defaultFS embed.FS
+
+// Site bundles the filesystem a minidoc server reads its templates and
+// content from. The zero value is not usable; construct one with
+// newOSSite or newEmbedSite.
+type Site struct {
+	FS   fs.FS
+	base string
+	live bool
+}
+
+// newOSSite returns a Site backed by the on-disk directory at root, the
+// behavior minidoc has always had.
+func newOSSite(root string) *Site {
+	s := &Site{FS: os.DirFS(root), base: ".", live: *f_live}
+	if err := s.initTemplates(); err != nil {
+		log.Fatalln(err)
+	}
+	startIndexer(s.FS, *f_reindex)
+	initRewrites()
+	return s
+}
+
+// newEmbedSite returns a Site backed by the templates and misc/ assets
+// baked into the binary, so the server can run with zero external files.
+func newEmbedSite() *Site {
+	s := &Site{FS: defaultFS, base: "."}
+	if err := s.initTemplates(); err != nil {
+		log.Fatalln(err)
+	}
+	startIndexer(s.FS, *f_reindex)
+	initRewrites()
+	return s
+}
+
+// initRewrites loads the rewrite engine from -rewrites, falling back to
+// the built-in default rule set (and logging) if the file can't be read.
+func initRewrites() {
+	e, err := loadRewrites(*f_rewrites)
+	if err != nil {
+		log.Errorln(err)
+		e, _ = loadRewrites("")
+	}
+	rewrites = e
+}
+
+// initTemplates (re-)parses the site's templates. When s.live is set,
+// dirHandler calls this on every request; otherwise it's called once at
+// startup.
+func (s *Site) initTemplates() error {
+	return initTemplates(s.FS, s.base)
+}
+
+// site is the Site in effect for the running server. It is set up in
+// main before the HTTP handlers registered by init() are invoked.
+var site *Site